@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/arangodb/go-driver/v2/arangodb"
+	"github.com/arangodb/go-driver/v2/arangodb/shared"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApiKey is a long-lived, scoped credential a user can issue for
+// programmatic access in place of a JWT. Only TokenHash is ever persisted;
+// the token itself is shown to the user once, at creation time.
+type ApiKey struct {
+	Key        string     `json:"_key,omitempty"`
+	AccountKey string     `json:"account_key"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	TokenHash  string     `json:"token_hash"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+type ApiKeyResponse struct {
+	Key        string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func generateApiKeyToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func hashApiKeyToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == "*" || s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects requests whose caller (JWT or API key) was not
+// granted scope. JWT-authenticated requests always hold the wildcard scope.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, _ := c.Locals("scopes").([]string)
+		if !hasScope(scopes, scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Missing required scope: " + scope,
+			})
+		}
+		return c.Next()
+	}
+}
+
+func CreateApiKeyHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		var req CreateApiKeyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		if req.Name == "" || len(req.Scopes) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name and scopes are required",
+			})
+		}
+
+		callerScopes, _ := c.Locals("scopes").([]string)
+		for _, scope := range req.Scopes {
+			if !hasScope(callerScopes, scope) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Cannot grant a scope beyond your own: " + scope,
+				})
+			}
+		}
+
+		token, err := generateApiKeyToken()
+		if err != nil {
+			log.Printf("Failed to generate API key token: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create API key",
+			})
+		}
+
+		apiKey := ApiKey{
+			AccountKey: userKey,
+			Name:       req.Name,
+			Scopes:     req.Scopes,
+			TokenHash:  hashApiKeyToken(token),
+			CreatedAt:  time.Now(),
+			ExpiresAt:  req.ExpiresAt,
+		}
+
+		doc, err := db.apiKeys.CreateDocument(ctx, apiKey)
+		if err != nil {
+			log.Printf("Failed to create API key: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create API key",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"id":     doc.Key,
+			"name":   apiKey.Name,
+			"scopes": apiKey.Scopes,
+			"token":  token,
+		})
+	}
+}
+
+func GetApiKeysHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		query := "FOR k IN api_keys FILTER k.account_key == @account_key SORT k.created_at DESC RETURN k"
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"account_key": userKey,
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to query API keys: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get API keys",
+			})
+		}
+		defer cursor.Close()
+
+		result := []ApiKeyResponse{}
+
+		for {
+			var apiKey ApiKey
+			meta, err := cursor.ReadDocument(ctx, &apiKey)
+			if shared.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				log.Printf("Failed to read API key: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to read API key",
+				})
+			}
+
+			result = append(result, ApiKeyResponse{
+				Key:        meta.Key,
+				Name:       apiKey.Name,
+				Scopes:     apiKey.Scopes,
+				CreatedAt:  apiKey.CreatedAt,
+				LastUsedAt: apiKey.LastUsedAt,
+				ExpiresAt:  apiKey.ExpiresAt,
+			})
+		}
+
+		return c.JSON(result)
+	}
+}
+
+func DeleteApiKeyHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		keyKey := c.Params("id")
+
+		var apiKey ApiKey
+		_, err := db.apiKeys.ReadDocument(ctx, keyKey, &apiKey)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "API key not found",
+			})
+		} else if err != nil {
+			log.Printf("Failed to get API key: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete API key",
+			})
+		}
+
+		if apiKey.AccountKey != userKey {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "API key not found",
+			})
+		}
+
+		_, err = db.apiKeys.DeleteDocument(ctx, keyKey)
+		if err != nil {
+			log.Printf("Failed to delete API key: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete API key",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "API key deleted",
+		})
+	}
+}
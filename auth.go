@@ -2,82 +2,19 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"log"
-	"math/big"
+	"strings"
 	"time"
 
 	"github.com/arangodb/go-driver/v2/arangodb"
-	"github.com/arangodb/go-driver/v2/arangodb/shared"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/nyaruka/phonenumbers"
 )
 
-type VerificationAttempt struct {
-	Key       string    `json:"-"`
-	Number    string    `json:"number"`
-	Code      string    `json:"code"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-type RequestVerificationRequest struct {
-	Number string `json:"number"`
-}
-
-type CancelVerificationRequest struct {
-	AttemptKey string `json:"attempt_key"`
-}
-
-type VerifyRequest struct {
-	AttemptKey string `json:"attempt_key"`
-	Code       string `json:"code"`
-}
-
-const VerificationExpiryTime = time.Minute * 5
-const JWTSecret = "MyAwesomeSecretForJWT"
-
-func CreateVerificationAttempt(ctx context.Context, db *Database, number string) (string, error) {
-	// TODO: Ensure only one verification attempt per user.
-	// Delete old ones on create or use number for key?
-
-	max := big.NewInt(1000000)
-	n, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		return "", err
-	}
-	code := fmt.Sprintf("%06d", n)
-
-	attempt := VerificationAttempt{
-		Number:    number,
-		Code:      code,
-		CreatedAt: time.Now(),
-	}
-
-	doc, err := db.verification_attempts.CreateDocument(ctx, attempt)
-	if err != nil {
-		return "", err
-	}
-
-	log.Printf("%v code is %v\n", doc.ID, code)
-
-	return doc.Key, nil
-}
-
-func VerifyCode(ctx context.Context, db *Database, attempt *VerificationAttempt, code string) (bool, error) {
-	if time.Now().After(attempt.CreatedAt.Add(VerificationExpiryTime)) {
-		db.verification_attempts.DeleteDocument(ctx, attempt.Key)
-		return false, nil
-	}
-
-	if attempt.Code == code {
-		db.verification_attempts.DeleteDocument(ctx, attempt.Key)
-		return true, nil
-	}
-
-	return false, nil
-}
+// scopeWildcard is granted to JWT-authenticated requests, which act with the
+// full authority of the signed-in user rather than a scoped API key.
+const scopeWildcard = "*"
 
 func CreateUser(ctx context.Context, db *Database, number string) (string, error) {
 	user := User{Number: number}
@@ -123,182 +60,186 @@ func GetOrCreateUser(ctx context.Context, db *Database, number string) (string,
 	return result, nil
 }
 
-func RequestVerificationHandler(db *Database) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
-		defer cancelCtx()
-
-		var req RequestVerificationRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request",
-			})
-		}
-
-		number, err := phonenumbers.Parse(req.Number, "SE")
-		if err != nil {
-			log.Printf("Failed to parse phone number: %v", err)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid phone number",
-			})
-		}
-
-		if !phonenumbers.IsValidNumberForRegion(number, "SE") {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid phone number for region.",
-			})
-		}
-
-		formattedNumber := phonenumbers.Format(number, phonenumbers.E164)
-
-		attemptKey, err := CreateVerificationAttempt(ctx, db, formattedNumber)
-		if err != nil {
-			log.Printf("Failed to create verification attempt: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to create verification attempt",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"message": "Verifcation code sent",
-			"id":      attemptKey,
-		})
+// GenerateJWT creates a session document fingerprinted with ip/userAgent and
+// signs a JWT referencing it via the `sid` claim, so the session can later be
+// looked up, fingerprint-checked, and revoked independently of the secret.
+func GenerateJWT(ctx context.Context, db *Database, userKey string, ip string, userAgent string) (string, error) {
+	now := time.Now()
+	session := Session{
+		UserKey:    userKey,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(db.config.JWTTTL),
 	}
-}
 
-func CancelVerificationHandler(db *Database) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
-		defer cancelCtx()
-
-		var req CancelVerificationRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request",
-			})
-		}
-
-		_, err := db.verification_attempts.DeleteDocument(ctx, req.AttemptKey)
-		if shared.IsNotFound(err) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": "Attempt not found",
-			})
-		} else if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to cancel verification attempt",
-			})
-		}
+	doc, err := db.sessions.CreateDocument(ctx, session)
+	if err != nil {
+		return "", err
+	}
 
-		return c.JSON(fiber.Map{
-			"message": "Verification canceled",
-		})
+	if err := AddEvent(ctx, db, userKey, EventSessionCreate, doc.Key, ip, userAgent); err != nil {
+		log.Printf("Failed to record session.create event: %v", err)
 	}
-}
 
-func GenerateJWT(userKey string) (string, error) {
-	expirationTime := time.Now().Add(time.Hour * 24 * 30).Unix()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"exp": expirationTime,
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
+		"exp": session.ExpiresAt.Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
 
 		"user_key": userKey,
+		"sid":      doc.Key,
 	})
-	jwt, err := token.SignedString([]byte(JWTSecret))
+	token.Header["kid"] = db.config.JWTActiveKid
+
+	signed, err := token.SignedString(db.config.JWTSecrets[db.config.JWTActiveKid])
 	if err != nil {
 		return "", err
 	}
 
-	return jwt, nil
+	return signed, nil
 }
 
-func VerifyRequestHandler(db *Database) fiber.Handler {
+// AuthMiddleware accepts either `Authorization: Bearer <jwt>` (the signed-in
+// user, full authority) or `Authorization: ApiKey <token>` (a scoped,
+// user-issued credential). Both set userKey and scopes in c.Locals.
+func AuthMiddleware(db *Database) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
-		defer cancelCtx()
-
-		var req VerifyRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request",
+		authHeader := c.Get("Authorization")
+		if authHeader == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Missing authorization header",
 			})
 		}
 
-		var attempt VerificationAttempt
-		_, err := db.verification_attempts.ReadDocument(ctx, req.AttemptKey, &attempt)
-		if err != nil {
-			log.Printf("Failed to get verification attempt: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to verify code",
-			})
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			return authenticateApiKey(c, db, authHeader[len("ApiKey "):])
 		}
 
-		attempt.Key = req.AttemptKey
-
-		valid, err := VerifyCode(ctx, db, &attempt, req.Code)
-		if err != nil {
-			log.Printf("Failed to verify code: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to verify code",
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authorization header",
 			})
 		}
 
-		if !valid {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid or expired verification code",
-			})
+		return authenticateJWT(c, db, authHeader[len("Bearer "):])
+	}
+}
+
+func authenticateJWT(c *fiber.Ctx, db *Database, tokenString string) error {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		userKey, err := GetOrCreateUser(ctx, db, attempt.Number)
-		if err != nil {
-			log.Printf("Failed to get or create user: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to log in to user account",
-			})
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing kid header")
 		}
 
-		jwt, err := GenerateJWT(userKey)
-		if err != nil {
-			log.Printf("Failed to sign JWT: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to log in to user account",
-			})
+		secret, ok := db.config.JWTSecrets[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid: %v", kid)
 		}
 
-		return c.JSON(fiber.Map{
-			"message": "User verified and created successfully",
-			"token":   jwt,
+		return secret, nil
+	})
+
+	if err != nil || !token.Valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+
+	ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*10)
+	defer cancelCtx()
+
+	var session Session
+	_, err = db.sessions.ReadDocument(ctx, sid, &session)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
 		})
 	}
+
+	if db.config.SessionStrictFingerprint && (session.IP != c.IP() || session.UserAgent != c.Get(fiber.HeaderUserAgent)) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+
+	session.LastSeenAt = time.Now()
+	db.sessions.UpdateDocument(ctx, sid, session)
+
+	c.Locals("userKey", claims["user_key"])
+	c.Locals("sid", sid)
+	c.Locals("scopes", []string{scopeWildcard})
+
+	return c.Next()
 }
 
-func AuthMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
-		}
+func authenticateApiKey(c *fiber.Ctx, db *Database, token string) error {
+	ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*10)
+	defer cancelCtx()
 
-		tokenString := authHeader[7:]
+	query := "FOR k IN api_keys FILTER k.token_hash == @hash LIMIT 1 RETURN k"
+	opts := arangodb.QueryOptions{
+		BindVars: map[string]interface{}{
+			"hash": hashApiKeyToken(token),
+		},
+	}
+	cursor, err := db.phonebook.Query(ctx, query, &opts)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+	defer cursor.Close()
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return "", fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(JWTSecret), nil
+	if !cursor.HasMore() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
 		})
+	}
 
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
-		}
+	var apiKey ApiKey
+	meta, err := cursor.ReadDocument(ctx, &apiKey)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
 
-		claims := token.Claims.(jwt.MapClaims)
-		c.Locals("userKey", claims["user_key"])
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
 
-		return c.Next()
+	now := time.Now()
+	apiKey.LastUsedAt = &now
+	if _, err := db.apiKeys.UpdateDocument(ctx, meta.Key, apiKey); err != nil {
+		log.Printf("Failed to update API key last_used_at: %v", err)
 	}
+
+	c.Locals("userKey", apiKey.AccountKey)
+	c.Locals("scopes", apiKey.Scopes)
+
+	return c.Next()
 }
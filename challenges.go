@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver/v2/arangodb"
+	"github.com/arangodb/go-driver/v2/arangodb/shared"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nyaruka/phonenumbers"
+)
+
+const (
+	FactorTypePhoneSMS   = "phone_sms"
+	FactorTypeTOTP       = "totp"
+	FactorTypeEmail      = "email"
+	FactorTypeBackupCode = "backup_code"
+)
+
+const ChallengeExpiryTime = time.Minute * 5
+
+// Factor is an enrolled authentication factor belonging to a user. Secret
+// holds factor-specific verification material: unused for phone_sms, the
+// base32 TOTP secret for totp, comma-separated SHA-256 hashes for
+// backup_code, and the target address for email.
+type Factor struct {
+	Key       string    `json:"_key,omitempty"`
+	UserKey   string    `json:"user_key"`
+	Type      string    `json:"type"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Challenge tracks a login attempt against one or more of a user's factors.
+// PendingCodes holds the generated one-time codes for phone_sms/email
+// factors and never leaves the server.
+type Challenge struct {
+	Key             string            `json:"_key,omitempty"`
+	UserKey         string            `json:"user_key"`
+	IP              string            `json:"ip"`
+	UserAgent       string            `json:"user_agent"`
+	CreatedAt       time.Time         `json:"created_at"`
+	ExpiresAt       time.Time         `json:"expires_at"`
+	Progress        []string          `json:"progress"`
+	RequiredFactors []string          `json:"required_factors"`
+	PendingCodes    map[string]string `json:"pending_codes,omitempty"`
+}
+
+type StartChallengeRequest struct {
+	Number string `json:"number"`
+}
+
+type AdvanceChallengeRequest struct {
+	ChallengeKey string `json:"challenge_id"`
+	FactorKey    string `json:"factor_id"`
+	Secret       string `json:"secret"`
+}
+
+type CreateFactorRequest struct {
+	Type string `json:"type"`
+}
+
+func generateNumericCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+func hashBackupCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateBackupCodes(count int) (codes []string, hashes []string, err error) {
+	for i := 0; i < count; i++ {
+		code, err := generateNumericCode(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashBackupCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func allCompleted(required []string, progress []string) bool {
+	for _, f := range required {
+		if !contains(progress, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func CreateFactor(ctx context.Context, db *Database, userKey string, factorType string, secret string) (string, error) {
+	factor := Factor{
+		UserKey:   userKey,
+		Type:      factorType,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+
+	meta, err := db.factors.CreateDocument(ctx, factor)
+	if err != nil {
+		return "", err
+	}
+
+	return meta.Key, nil
+}
+
+func GetFactors(ctx context.Context, db *Database, userKey string) ([]Factor, error) {
+	query := "FOR f IN factors FILTER f.user_key == @user_key RETURN f"
+	opts := arangodb.QueryOptions{
+		BindVars: map[string]interface{}{
+			"user_key": userKey,
+		},
+	}
+	cursor, err := db.phonebook.Query(ctx, query, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var factors []Factor
+
+	for {
+		var factor Factor
+		meta, err := cursor.ReadDocument(ctx, &factor)
+		if shared.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		factor.Key = meta.Key
+		factors = append(factors, factor)
+	}
+
+	return factors, nil
+}
+
+func verifyFactor(ctx context.Context, db *Database, factor *Factor, challenge *Challenge, secret string) (bool, error) {
+	switch factor.Type {
+	case FactorTypePhoneSMS, FactorTypeEmail:
+		return challenge.PendingCodes[factor.Key] == secret, nil
+
+	case FactorTypeTOTP:
+		return ValidateTOTP(factor.Secret, secret), nil
+
+	case FactorTypeBackupCode:
+		hash := hashBackupCode(secret)
+		codes := strings.Split(factor.Secret, ",")
+		for i, c := range codes {
+			if c == hash {
+				codes = append(codes[:i], codes[i+1:]...)
+				factor.Secret = strings.Join(codes, ",")
+				_, err := db.factors.UpdateDocument(ctx, factor.Key, factor)
+				return true, err
+			}
+		}
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("unknown factor type: %v", factor.Type)
+	}
+}
+
+func StartChallengeHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		var req StartChallengeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		number, err := phonenumbers.Parse(req.Number, db.config.DefaultRegion)
+		if err != nil {
+			log.Printf("Failed to parse phone number: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid phone number",
+			})
+		}
+
+		if !phonenumbers.IsValidNumberForRegion(number, db.config.DefaultRegion) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid phone number for region.",
+			})
+		}
+
+		formattedNumber := phonenumbers.Format(number, phonenumbers.E164)
+
+		userKey, err := GetOrCreateUser(ctx, db, formattedNumber)
+		if err != nil {
+			log.Printf("Failed to get or create user: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start challenge",
+			})
+		}
+
+		factors, err := GetFactors(ctx, db, userKey)
+		if err != nil {
+			log.Printf("Failed to get factors: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start challenge",
+			})
+		}
+
+		if len(factors) == 0 {
+			factorKey, err := CreateFactor(ctx, db, userKey, FactorTypePhoneSMS, "")
+			if err != nil {
+				log.Printf("Failed to create default factor: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to start challenge",
+				})
+			}
+			factors = append(factors, Factor{Key: factorKey, UserKey: userKey, Type: FactorTypePhoneSMS})
+		}
+
+		requiredFactors := make([]string, 0, len(factors))
+		for _, f := range factors {
+			requiredFactors = append(requiredFactors, f.Key)
+		}
+
+		challenge := Challenge{
+			UserKey:         userKey,
+			IP:              c.IP(),
+			UserAgent:       c.Get(fiber.HeaderUserAgent),
+			CreatedAt:       time.Now(),
+			ExpiresAt:       time.Now().Add(ChallengeExpiryTime),
+			Progress:        []string{},
+			RequiredFactors: requiredFactors,
+			PendingCodes:    map[string]string{},
+		}
+
+		for _, f := range factors {
+			if f.Type == FactorTypePhoneSMS || f.Type == FactorTypeEmail {
+				code, err := generateNumericCode(6)
+				if err != nil {
+					log.Printf("Failed to generate verification code: %v", err)
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to start challenge",
+					})
+				}
+				challenge.PendingCodes[f.Key] = code
+				log.Printf("Factor %v code is %v\n", f.Key, code)
+			}
+		}
+
+		doc, err := db.challenges.CreateDocument(ctx, challenge)
+		if err != nil {
+			log.Printf("Failed to create challenge: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start challenge",
+			})
+		}
+
+		if err := AddEvent(ctx, db, userKey, EventVerificationRequest, doc.Key, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+			log.Printf("Failed to record verification.request event: %v", err)
+		}
+
+		factorTypes := make([]string, 0, len(factors))
+		for _, f := range factors {
+			factorTypes = append(factorTypes, f.Type)
+		}
+
+		return c.JSON(fiber.Map{
+			"challenge_id": doc.Key,
+			"factors":      factorTypes,
+		})
+	}
+}
+
+func AdvanceChallengeHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		var req AdvanceChallengeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		var challenge Challenge
+		_, err := db.challenges.ReadDocument(ctx, req.ChallengeKey, &challenge)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		} else if err != nil {
+			log.Printf("Failed to get challenge: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to advance challenge",
+			})
+		}
+		challenge.Key = req.ChallengeKey
+
+		if time.Now().After(challenge.ExpiresAt) {
+			db.challenges.DeleteDocument(ctx, challenge.Key)
+
+			if err := AddEvent(ctx, db, challenge.UserKey, EventVerificationCancel, challenge.Key, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+				log.Printf("Failed to record verification.cancel event: %v", err)
+			}
+
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Challenge expired",
+			})
+		}
+
+		if !contains(challenge.RequiredFactors, req.FactorKey) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Factor not part of challenge",
+			})
+		}
+
+		if contains(challenge.Progress, req.FactorKey) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Factor already completed",
+			})
+		}
+
+		var factor Factor
+		_, err = db.factors.ReadDocument(ctx, req.FactorKey, &factor)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Factor not found",
+			})
+		} else if err != nil {
+			log.Printf("Failed to get factor: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to advance challenge",
+			})
+		}
+		factor.Key = req.FactorKey
+
+		valid, err := verifyFactor(ctx, db, &factor, &challenge, req.Secret)
+		if err != nil {
+			log.Printf("Failed to verify factor: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to advance challenge",
+			})
+		}
+
+		if !valid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid secret",
+			})
+		}
+
+		challenge.Progress = append(challenge.Progress, req.FactorKey)
+		delete(challenge.PendingCodes, req.FactorKey)
+
+		if allCompleted(challenge.RequiredFactors, challenge.Progress) {
+			db.challenges.DeleteDocument(ctx, challenge.Key)
+
+			if err := AddEvent(ctx, db, challenge.UserKey, EventVerificationSuccess, challenge.Key, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+				log.Printf("Failed to record verification.success event: %v", err)
+			}
+
+			jwt, err := GenerateJWT(ctx, db, challenge.UserKey, c.IP(), c.Get(fiber.HeaderUserAgent))
+			if err != nil {
+				log.Printf("Failed to sign JWT: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to log in to user account",
+				})
+			}
+
+			return c.JSON(fiber.Map{
+				"message": "Challenge completed",
+				"token":   jwt,
+			})
+		}
+
+		_, err = db.challenges.UpdateDocument(ctx, challenge.Key, challenge)
+		if err != nil {
+			log.Printf("Failed to update challenge: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to advance challenge",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message":  "Factor verified",
+			"progress": challenge.Progress,
+		})
+	}
+}
+
+func CreateFactorHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		var req CreateFactorRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		switch req.Type {
+		case FactorTypeTOTP:
+			secret, err := GenerateTOTPSecret()
+			if err != nil {
+				log.Printf("Failed to generate TOTP secret: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to enroll factor",
+				})
+			}
+
+			factorKey, err := CreateFactor(ctx, db, userKey, FactorTypeTOTP, secret)
+			if err != nil {
+				log.Printf("Failed to create factor: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to enroll factor",
+				})
+			}
+
+			return c.JSON(fiber.Map{
+				"id":     factorKey,
+				"type":   FactorTypeTOTP,
+				"secret": secret,
+			})
+
+		case FactorTypeBackupCode:
+			codes, hashes, err := generateBackupCodes(10)
+			if err != nil {
+				log.Printf("Failed to generate backup codes: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to enroll factor",
+				})
+			}
+
+			factorKey, err := CreateFactor(ctx, db, userKey, FactorTypeBackupCode, strings.Join(hashes, ","))
+			if err != nil {
+				log.Printf("Failed to create factor: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to enroll factor",
+				})
+			}
+
+			return c.JSON(fiber.Map{
+				"id":    factorKey,
+				"type":  FactorTypeBackupCode,
+				"codes": codes,
+			})
+
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unsupported factor type",
+			})
+		}
+	}
+}
+
+func DeleteFactorHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		factorKey := c.Params("id")
+
+		var factor Factor
+		_, err := db.factors.ReadDocument(ctx, factorKey, &factor)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Factor not found",
+			})
+		} else if err != nil {
+			log.Printf("Failed to get factor: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete factor",
+			})
+		}
+
+		if factor.UserKey != userKey {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Factor not found",
+			})
+		}
+
+		_, err = db.factors.DeleteDocument(ctx, factorKey)
+		if err != nil {
+			log.Printf("Failed to delete factor: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete factor",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Factor deleted",
+		})
+	}
+}
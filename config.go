@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultJWTSecrets preserves the previous hardcoded signing key under kid
+// "default" when JWT_SECRETS is not set, so existing deployments keep working.
+const defaultJWTSecrets = "default:TXlBd2Vzb21lU2VjcmV0Rm9ySldU"
+
+// Config holds everything the app previously had hardcoded, loaded from the
+// environment so secrets and defaults can change without a rebuild.
+type Config struct {
+	JWTSecrets     map[string][]byte
+	JWTActiveKid   string
+	JWTTTL         time.Duration
+	ArangoEndpoint string
+	ArangoUser     string
+	ArangoPassword string
+	DefaultRegion  string
+
+	// SessionStrictFingerprint controls whether AuthMiddleware refuses
+	// requests whose IP/User-Agent no longer match the fingerprint recorded
+	// at session issuance.
+	SessionStrictFingerprint bool
+}
+
+func LoadConfig() Config {
+	secrets, err := parseJWTSecrets(getEnv("JWT_SECRETS", defaultJWTSecrets))
+	if err != nil {
+		log.Fatalf("Failed to parse JWT_SECRETS: %v", err)
+	}
+
+	activeKid := getEnv("JWT_ACTIVE_KID", "default")
+	if _, ok := secrets[activeKid]; !ok {
+		log.Fatalf("JWT_ACTIVE_KID %q has no matching entry in JWT_SECRETS", activeKid)
+	}
+
+	ttl, err := time.ParseDuration(getEnv("JWT_TTL", "720h"))
+	if err != nil {
+		log.Fatalf("Failed to parse JWT_TTL: %v", err)
+	}
+
+	strictFingerprint, err := strconv.ParseBool(getEnv("SESSION_STRICT_FINGERPRINT", "false"))
+	if err != nil {
+		log.Fatalf("Failed to parse SESSION_STRICT_FINGERPRINT: %v", err)
+	}
+
+	return Config{
+		JWTSecrets:               secrets,
+		JWTActiveKid:             activeKid,
+		JWTTTL:                   ttl,
+		ArangoEndpoint:           getEnv("ARANGO_ENDPOINT", "http://localhost:8529"),
+		ArangoUser:               getEnv("ARANGO_USER", "root"),
+		ArangoPassword:           getEnv("ARANGO_PASSWORD", "openSesame"),
+		DefaultRegion:            getEnv("DEFAULT_REGION", "SE"),
+		SessionStrictFingerprint: strictFingerprint,
+	}
+}
+
+func getEnv(key string, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// parseJWTSecrets parses a comma-separated list of "kid:base64secret" pairs,
+// as found in JWT_SECRETS. Keeping every kid around (not just the active one)
+// lets tokens signed with a since-rotated key keep validating.
+func parseJWTSecrets(raw string) (map[string][]byte, error) {
+	secrets := make(map[string][]byte)
+
+	for _, pair := range strings.Split(raw, ",") {
+		kid, encoded, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid kid:secret pair: %q", pair)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 secret for kid %q: %w", kid, err)
+		}
+
+		secrets[kid] = secret
+	}
+
+	return secrets, nil
+}
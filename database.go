@@ -12,10 +12,16 @@ import (
 const DatabaseName = "phonebook"
 
 type Database struct {
-	phonebook             arangodb.Database
-	users                 arangodb.Collection
-	contacts              arangodb.Collection
-	verification_attempts arangodb.Collection
+	config        Config
+	phonebook     arangodb.Database
+	users         arangodb.Collection
+	contacts      arangodb.Collection
+	challenges    arangodb.Collection
+	factors       arangodb.Collection
+	sessions      arangodb.Collection
+	events        arangodb.Collection
+	notifications arangodb.Collection
+	apiKeys       arangodb.Collection
 }
 
 func getCollection(ctx context.Context, db arangodb.Database, name string, colType arangodb.CollectionType) (arangodb.Collection, error) {
@@ -44,11 +50,11 @@ func getCollection(ctx context.Context, db arangodb.Database, name string, colTy
 	return col, nil
 }
 
-func SetupDBClient(ctx context.Context) Database {
-	endpoint := connection.NewRoundRobinEndpoints([]string{"http://localhost:8529"})
+func SetupDBClient(ctx context.Context, cfg Config) Database {
+	endpoint := connection.NewRoundRobinEndpoints([]string{cfg.ArangoEndpoint})
 	conn := connection.NewHttp2Connection(connection.DefaultHTTP2ConfigurationWrapper(endpoint, true))
 
-	auth := connection.NewBasicAuth("root", "openSesame")
+	auth := connection.NewBasicAuth(cfg.ArangoUser, cfg.ArangoPassword)
 	err := conn.SetAuthentication(auth)
 	if err != nil {
 		log.Fatalf("Failed to set authentication %v", err)
@@ -57,6 +63,7 @@ func SetupDBClient(ctx context.Context) Database {
 	client := arangodb.NewClient(conn)
 
 	var db Database
+	db.config = cfg
 
 	// Ensure database exists
 	dbExists, err := client.DatabaseExists(ctx, DatabaseName)
@@ -88,10 +95,45 @@ func SetupDBClient(ctx context.Context) Database {
 		log.Fatalf("Failed to create contacts collection: %v", err)
 	}
 
-	// Ensure verification collection exists
-	db.verification_attempts, err = getCollection(ctx, db.phonebook, "verification_attempts", arangodb.CollectionTypeDocument)
+	// Ensure challenges collection exists
+	db.challenges, err = getCollection(ctx, db.phonebook, "challenges", arangodb.CollectionTypeDocument)
 	if err != nil && !shared.IsConflict(err) {
-		log.Fatalf("Failed to create verification_attempts collection: %v", err)
+		log.Fatalf("Failed to create challenges collection: %v", err)
+	}
+
+	// Ensure factors collection exists
+	db.factors, err = getCollection(ctx, db.phonebook, "factors", arangodb.CollectionTypeDocument)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create factors collection: %v", err)
+	}
+
+	// Ensure sessions collection exists
+	db.sessions, err = getCollection(ctx, db.phonebook, "sessions", arangodb.CollectionTypeDocument)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create sessions collection: %v", err)
+	}
+
+	// Ensure events collection exists, indexed for per-user history lookups
+	db.events, err = getCollection(ctx, db.phonebook, "events", arangodb.CollectionTypeDocument)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create events collection: %v", err)
+	}
+
+	_, _, err = db.events.EnsurePersistentIndex(ctx, []string{"user_key", "created_at"}, nil)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create events index: %v", err)
+	}
+
+	// Ensure notifications collection exists
+	db.notifications, err = getCollection(ctx, db.phonebook, "notifications", arangodb.CollectionTypeDocument)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create notifications collection: %v", err)
+	}
+
+	// Ensure api_keys collection exists
+	db.apiKeys, err = getCollection(ctx, db.phonebook, "api_keys", arangodb.CollectionTypeDocument)
+	if err != nil && !shared.IsConflict(err) {
+		log.Fatalf("Failed to create api_keys collection: %v", err)
 	}
 
 	return db
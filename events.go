@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/arangodb/go-driver/v2/arangodb"
+	"github.com/arangodb/go-driver/v2/arangodb/shared"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	EventVerificationRequest = "verification.request"
+	EventVerificationSuccess = "verification.success"
+	EventVerificationCancel  = "verification.cancel"
+	EventContactsAdd         = "contacts.add"
+	EventContactsUpdate      = "contacts.update"
+	EventSessionCreate       = "session.create"
+	EventSessionRevoke       = "session.revoke"
+)
+
+// Event is an audit log entry recording a significant action taken by or on
+// behalf of a user.
+type Event struct {
+	Key       string    `json:"_key,omitempty"`
+	UserKey   string    `json:"user_key"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type EventResponse struct {
+	Key       string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func AddEvent(ctx context.Context, db *Database, userKey string, kind string, target string, ip string, ua string) error {
+	event := Event{
+		UserKey:   userKey,
+		Kind:      kind,
+		Target:    target,
+		IP:        ip,
+		UserAgent: ua,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := db.events.CreateDocument(ctx, event)
+	return err
+}
+
+func GetEventsHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		take, err := strconv.Atoi(c.Query("take", "20"))
+		if err != nil || take <= 0 || take > 100 {
+			take = 20
+		}
+
+		offset, err := strconv.Atoi(c.Query("offset", "0"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		kind := c.Query("kind")
+
+		query := `FOR e IN events
+			FILTER e.user_key == @user_key AND (@kind == "" OR e.kind == @kind)
+			SORT e.created_at DESC
+			LIMIT @offset, @take
+			RETURN e`
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"user_key": userKey,
+				"kind":     kind,
+				"offset":   offset,
+				"take":     take,
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to query events: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get events"})
+		}
+		defer cursor.Close()
+
+		result := []EventResponse{}
+
+		for {
+			var event Event
+			meta, err := cursor.ReadDocument(ctx, &event)
+			if shared.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				log.Printf("Failed to read event: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read event"})
+			}
+
+			result = append(result, EventResponse{
+				Key:       meta.Key,
+				Kind:      event.Kind,
+				Target:    event.Target,
+				IP:        event.IP,
+				UserAgent: event.UserAgent,
+				CreatedAt: event.CreatedAt,
+			})
+		}
+
+		countQuery := `FOR e IN events FILTER e.user_key == @user_key AND (@kind == "" OR e.kind == @kind) COLLECT WITH COUNT INTO count RETURN count`
+		countOpts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"user_key": userKey,
+				"kind":     kind,
+			},
+		}
+		countCursor, err := db.phonebook.Query(ctx, countQuery, &countOpts)
+		if err != nil {
+			log.Printf("Failed to count events: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get events"})
+		}
+		defer countCursor.Close()
+
+		var count int
+		if countCursor.HasMore() {
+			if _, err := countCursor.ReadDocument(ctx, &count); err != nil {
+				log.Printf("Failed to read event count: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get events"})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"count": count,
+			"data":  result,
+		})
+	}
+}
@@ -45,6 +45,9 @@ func AddContactsHandler(db *Database) fiber.Handler {
 
 		for _, contact := range request.Contacts {
 			countryCode := strings.ToUpper(contact.CountryCode)
+			if countryCode == "" {
+				countryCode = db.config.DefaultRegion
+			}
 
 			number, err := phonenumbers.Parse(contact.Number, countryCode)
 			if err != nil {
@@ -94,6 +97,10 @@ func AddContactsHandler(db *Database) fiber.Handler {
 						log.Printf("Failed to update contact name: %v", err)
 						return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update contact name"})
 					}
+
+					if err := AddEvent(ctx, db, userKey, EventContactsUpdate, contactUserKey, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+						log.Printf("Failed to record contacts.update event: %v", err)
+					}
 				}
 
 				continue
@@ -110,6 +117,41 @@ func AddContactsHandler(db *Database) fiber.Handler {
 				log.Printf("Failed to create contact edge: %v", err)
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create contact relationship"})
 			}
+
+			if err := AddEvent(ctx, db, userKey, EventContactsAdd, contactUserKey, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+				log.Printf("Failed to record contacts.add event: %v", err)
+			}
+
+			reciprocalQuery := "FOR c IN contacts FILTER c._from == @from AND c._to == @to LIMIT 1 RETURN c"
+			reciprocalOpts := arangodb.QueryOptions{
+				BindVars: map[string]interface{}{
+					"from": "users/" + contactUserKey,
+					"to":   "users/" + userKey,
+				},
+			}
+			reciprocalCursor, err := db.phonebook.Query(ctx, reciprocalQuery, &reciprocalOpts)
+			if err != nil {
+				log.Printf("Failed to check contact reciprocity: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check existing contacts"})
+			}
+			mutual := reciprocalCursor.HasMore()
+			reciprocalCursor.Close()
+
+			if mutual {
+				if err := CreateNotification(ctx, db, userKey, NotificationContactMutual, map[string]interface{}{
+					"user_key": contactUserKey,
+					"name":     contact.Name,
+				}); err != nil {
+					log.Printf("Failed to create contact.mutual notification: %v", err)
+				}
+			}
+
+			if err := CreateNotification(ctx, db, contactUserKey, NotificationContactAddedYou, map[string]interface{}{
+				"user_key": userKey,
+				"name":     contact.Name,
+			}); err != nil {
+				log.Printf("Failed to create contact.added_you notification: %v", err)
+			}
 		}
 
 		return c.JSON(fiber.Map{"message": "Contacts added"})
@@ -178,14 +220,26 @@ func RunWebServer(db *Database) {
 		return c.SendString("pong")
 	})
 
-	app.Post("/request-verification", RequestVerificationHandler(db))
-	app.Post("/cancel-verification", CancelVerificationHandler(db))
-	app.Post("/verify", VerifyRequestHandler(db))
+	app.Post("/challenge/start", StartChallengeHandler(db))
+	app.Post("/challenge/advance", AdvanceChallengeHandler(db))
 
 	api := app.Group("/api")
-	api.Use(AuthMiddleware())
+	api.Use(AuthMiddleware(db))
 
-	api.Get("/me", func(c *fiber.Ctx) error {
+	api.Post("/factors", RequireScope("factors:write"), CreateFactorHandler(db))
+	api.Delete("/factors/:id", RequireScope("factors:write"), DeleteFactorHandler(db))
+
+	api.Get("/sessions", RequireScope("sessions:read"), ListSessionsHandler(db))
+	api.Delete("/sessions/:id", RequireScope("sessions:write"), RevokeSessionHandler(db))
+	api.Post("/sessions/revoke-all", RequireScope("sessions:write"), RevokeAllSessionsHandler(db))
+
+	api.Get("/events", RequireScope("events:read"), GetEventsHandler(db))
+
+	api.Get("/notifications", RequireScope("notifications:read"), GetNotificationsHandler(db))
+	api.Post("/notifications/:id/read", RequireScope("notifications:write"), MarkNotificationReadHandler(db))
+	api.Post("/notifications/read-all", RequireScope("notifications:write"), MarkAllNotificationsReadHandler(db))
+
+	api.Get("/me", RequireScope("profile:read"), func(c *fiber.Ctx) error {
 		userKey := c.Locals("userKey").(string)
 
 		var user User
@@ -200,8 +254,12 @@ func RunWebServer(db *Database) {
 		})
 	})
 
-	api.Post("/add-contacts", AddContactsHandler(db))
-	api.Get("/contacts", GetContactsHandler(db))
+	api.Post("/add-contacts", RequireScope("contacts:write"), AddContactsHandler(db))
+	api.Get("/contacts", RequireScope("contacts:read"), GetContactsHandler(db))
+
+	api.Post("/keys", RequireScope("apikeys:write"), CreateApiKeyHandler(db))
+	api.Get("/keys", RequireScope("apikeys:read"), GetApiKeysHandler(db))
+	api.Delete("/keys/:id", RequireScope("apikeys:write"), DeleteApiKeyHandler(db))
 
 	app.Listen(":3000")
 }
@@ -230,7 +288,8 @@ TODO:
 func main() {
 	ctx := context.Background()
 
-	db := SetupDBClient(ctx)
+	cfg := LoadConfig()
+	db := SetupDBClient(ctx, cfg)
 
 	RunWebServer(&db)
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/arangodb/go-driver/v2/arangodb"
+	"github.com/arangodb/go-driver/v2/arangodb/shared"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	NotificationContactMutual   = "contact.mutual"
+	NotificationContactAddedYou = "contact.added_you"
+)
+
+// Notification is an in-app notification delivered to recipient_key.
+// Payload shape depends on Kind.
+type Notification struct {
+	Key          string                 `json:"_key,omitempty"`
+	RecipientKey string                 `json:"recipient_key"`
+	Kind         string                 `json:"kind"`
+	Payload      map[string]interface{} `json:"payload"`
+	CreatedAt    time.Time              `json:"created_at"`
+	ReadAt       *time.Time             `json:"read_at,omitempty"`
+}
+
+type NotificationResponse struct {
+	Key       string                 `json:"id"`
+	Kind      string                 `json:"kind"`
+	Payload   map[string]interface{} `json:"payload"`
+	CreatedAt time.Time              `json:"created_at"`
+	ReadAt    *time.Time             `json:"read_at,omitempty"`
+}
+
+func CreateNotification(ctx context.Context, db *Database, recipientKey string, kind string, payload map[string]interface{}) error {
+	notification := Notification{
+		RecipientKey: recipientKey,
+		Kind:         kind,
+		Payload:      payload,
+		CreatedAt:    time.Now(),
+	}
+
+	_, err := db.notifications.CreateDocument(ctx, notification)
+	return err
+}
+
+func GetNotificationsHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		past := c.Query("past", "false") == "true"
+
+		take, err := strconv.Atoi(c.Query("take", "20"))
+		if err != nil || take <= 0 || take > 100 {
+			take = 20
+		}
+
+		offset, err := strconv.Atoi(c.Query("offset", "0"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		query := `FOR n IN notifications
+			FILTER n.recipient_key == @recipient_key AND (@past OR n.read_at == null)
+			SORT n.read_at DESC, n.created_at DESC
+			LIMIT @offset, @take
+			RETURN n`
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"recipient_key": userKey,
+				"past":          past,
+				"offset":        offset,
+				"take":          take,
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to query notifications: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notifications"})
+		}
+		defer cursor.Close()
+
+		result := []NotificationResponse{}
+
+		for {
+			var notification Notification
+			meta, err := cursor.ReadDocument(ctx, &notification)
+			if shared.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				log.Printf("Failed to read notification: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read notification"})
+			}
+
+			result = append(result, NotificationResponse{
+				Key:       meta.Key,
+				Kind:      notification.Kind,
+				Payload:   notification.Payload,
+				CreatedAt: notification.CreatedAt,
+				ReadAt:    notification.ReadAt,
+			})
+		}
+
+		countQuery := `FOR n IN notifications FILTER n.recipient_key == @recipient_key AND (@past OR n.read_at == null) COLLECT WITH COUNT INTO count RETURN count`
+		countOpts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"recipient_key": userKey,
+				"past":          past,
+			},
+		}
+		countCursor, err := db.phonebook.Query(ctx, countQuery, &countOpts)
+		if err != nil {
+			log.Printf("Failed to count notifications: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notifications"})
+		}
+		defer countCursor.Close()
+
+		var count int
+		if countCursor.HasMore() {
+			if _, err := countCursor.ReadDocument(ctx, &count); err != nil {
+				log.Printf("Failed to read notification count: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notifications"})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"count": count,
+			"data":  result,
+		})
+	}
+}
+
+func MarkNotificationReadHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		notificationKey := c.Params("id")
+
+		var notification Notification
+		_, err := db.notifications.ReadDocument(ctx, notificationKey, &notification)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+		} else if err != nil {
+			log.Printf("Failed to get notification: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read notification"})
+		}
+
+		if notification.RecipientKey != userKey {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+		}
+
+		now := time.Now()
+		notification.ReadAt = &now
+
+		_, err = db.notifications.UpdateDocument(ctx, notificationKey, notification)
+		if err != nil {
+			log.Printf("Failed to mark notification read: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read notification"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Notification marked as read"})
+	}
+}
+
+func MarkAllNotificationsReadHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+
+		query := `FOR n IN notifications
+			FILTER n.recipient_key == @recipient_key AND n.read_at == null
+			UPDATE n WITH { read_at: @now } IN notifications`
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"recipient_key": userKey,
+				"now":           time.Now(),
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to mark notifications read: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark notifications read"})
+		}
+		defer cursor.Close()
+
+		return c.JSON(fiber.Map{"message": "All notifications marked as read"})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/arangodb/go-driver/v2/arangodb"
+	"github.com/arangodb/go-driver/v2/arangodb/shared"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Session is a server-side record backing an issued JWT, identified by the
+// `sid` claim, so it can be revoked without rotating the signing secret.
+type Session struct {
+	Key        string     `json:"_key,omitempty"`
+	UserKey    string     `json:"user_key"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type SessionResponse struct {
+	Key        string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func ListSessionsHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		currentSid, ok := c.Locals("sid").(string)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Sessions are only available to JWT-authenticated requests"})
+		}
+
+		query := "FOR s IN sessions FILTER s.user_key == @user_key AND s.revoked_at == null AND s.expires_at > @now SORT s.last_seen_at DESC RETURN s"
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"user_key": userKey,
+				"now":      time.Now(),
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to list sessions: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list sessions"})
+		}
+		defer cursor.Close()
+
+		result := []SessionResponse{}
+
+		for {
+			var session Session
+			meta, err := cursor.ReadDocument(ctx, &session)
+			if shared.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				log.Printf("Failed to read session: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read session"})
+			}
+
+			result = append(result, SessionResponse{
+				Key:        meta.Key,
+				IP:         session.IP,
+				UserAgent:  session.UserAgent,
+				CreatedAt:  session.CreatedAt,
+				LastSeenAt: session.LastSeenAt,
+				ExpiresAt:  session.ExpiresAt,
+				Current:    meta.Key == currentSid,
+			})
+		}
+
+		return c.JSON(result)
+	}
+}
+
+func RevokeSessionHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		sessionKey := c.Params("id")
+
+		var session Session
+		_, err := db.sessions.ReadDocument(ctx, sessionKey, &session)
+		if shared.IsNotFound(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		} else if err != nil {
+			log.Printf("Failed to get session: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+
+		if session.UserKey != userKey {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+
+		now := time.Now()
+		session.RevokedAt = &now
+
+		_, err = db.sessions.UpdateDocument(ctx, sessionKey, session)
+		if err != nil {
+			log.Printf("Failed to revoke session: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+
+		if err := AddEvent(ctx, db, userKey, EventSessionRevoke, sessionKey, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+			log.Printf("Failed to record session.revoke event: %v", err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Session revoked"})
+	}
+}
+
+func RevokeAllSessionsHandler(db *Database) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancelCtx := context.WithTimeout(c.UserContext(), time.Second*30)
+		defer cancelCtx()
+
+		userKey := c.Locals("userKey").(string)
+		currentSid, ok := c.Locals("sid").(string)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Sessions are only available to JWT-authenticated requests"})
+		}
+
+		query := `FOR s IN sessions
+			FILTER s.user_key == @user_key AND s._key != @current AND s.revoked_at == null
+			UPDATE s WITH { revoked_at: @now } IN sessions`
+		opts := arangodb.QueryOptions{
+			BindVars: map[string]interface{}{
+				"user_key": userKey,
+				"current":  currentSid,
+				"now":      time.Now(),
+			},
+		}
+		cursor, err := db.phonebook.Query(ctx, query, &opts)
+		if err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+		}
+		defer cursor.Close()
+
+		if err := AddEvent(ctx, db, userKey, EventSessionRevoke, "all", c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+			log.Printf("Failed to record session.revoke event: %v", err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Other sessions revoked"})
+	}
+}